@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestFuncMap(t *testing.T) {
+	orig := *funcSets
+	defer func() { *funcSets = orig }()
+
+	*funcSets = "sprig"
+	fm := funcMap()
+	for _, name := range []string{"quote", "default"} {
+		if _, ok := fm[name]; !ok {
+			t.Errorf("-funcs=sprig: expected %q in FuncMap", name)
+		}
+	}
+
+	*funcSets = "env"
+	fm = funcMap()
+	if len(fm) != 2 {
+		t.Errorf("-funcs=env: FuncMap = %v, want exactly getenv/expandenv", fm)
+	}
+	for _, name := range []string{"getenv", "expandenv"} {
+		if _, ok := fm[name]; !ok {
+			t.Errorf("-funcs=env: expected %q in FuncMap", name)
+		}
+	}
+
+	*funcSets = "none"
+	fm = funcMap()
+	if len(fm) != 0 {
+		t.Errorf("-funcs=none: FuncMap = %v, want empty", fm)
+	}
+
+	*funcSets = "bogus"
+	fm = funcMap()
+	if len(fm) != 0 {
+		t.Errorf("unknown -funcs set should be ignored, FuncMap = %v, want empty", fm)
+	}
+}
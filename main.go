@@ -15,6 +15,12 @@
 //
 //     gotmpl -logtostderr -d dat.yml cfg.txt.tmpl > cfg.txt
 //
+//     gotmpl -d defaults.yml -d prod.yml -set replicas=3 cfg.txt.tmpl > cfg.txt
+//
+//     gotmpl -serve :8080 cfg.txt.tmpl cfg2.txt.tmpl
+//
+//     gotmpl -partials 'layouts/*.tmpl' -partials 'includes/**/*.tmpl' cfg.txt.tmpl > cfg.txt
+//
 //     gotmpl -h
 //
 //
@@ -22,6 +28,48 @@
 // parsers in that order and takes the result of the first one that
 // doesn't complain.
 //
+// -d may be repeated to layer multiple data files; they are deep
+// merged in the order given, with later files winning on conflicting
+// keys. -set key.path=value applies one-off overrides on top of the
+// merged result, creating intermediate maps as needed.
+//
+// -format yaml|json|hcl|toml forces a specific parser instead of the
+// "auto" cascade, surfacing that parser's own error (with line/column
+// for JSON) rather than a composite "failed to parse as any" message.
+// A YAML file containing multiple "---"-separated documents is
+// exposed to templates as a top-level .Documents slice rather than
+// silently taking just the first one.
+//
+// Templates are parsed with the Masterminds/sprig function library
+// attached by default, so helpers like {{ .foo | default "bar" | quote }}
+// work out of the box. Use -funcs=env,none to swap in getenv/expandenv
+// only or drop to the text/template builtins.
+//
+// -partials loads the root template together with any files matched
+// by its glob patterns (see github.com/msample/gotmpl/pkg/tmpl) so
+// {{ template "header" . }} can reference partials from other files;
+// -trim-prefix/-trim-suffix control the template name each file is
+// registered under.
+//
+// -o writes rendered output to disk instead of concatenating
+// everything to stdout: given a directory, each input template is
+// written to <dir>/<basename-without-.tmpl>; if the merged data has a
+// top-level ConfigFiles array of {source, destination, mode, owner,
+// group} entries, each is rendered from source and written straight
+// to destination with the given chmod/chown applied instead.
+//
+// -serve turns gotmpl into a small HTTP rendering service: the given
+// template files are loaded once and POST /render/{name} renders the
+// named one against a request body (content-type sniffed the same
+// way as -d files), and GET /templates lists what's loaded. POST
+// /render additionally accepts a multipart body carrying an ad hoc
+// "template" and "data" part, letting the caller supply template text
+// that was never reviewed at startup; since that text executes with
+// the process's own FuncMap, -serve-allow-adhoc must be set to enable
+// it, and even then env/expandenv/getHostByName are withheld from it
+// so a caller can't use it to read this process's environment or
+// probe its network.
+//
 // Use -logtostderr option if having problems. Template syntax defined
 // here: https://godoc.org/text/template
 package main
@@ -31,20 +79,55 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"text/template"
 
+	"github.com/Masterminds/sprig/v3"
 	"github.com/golang/glog"
 	"github.com/hashicorp/hcl"
+	gtmpl "github.com/msample/gotmpl/pkg/tmpl"
 	toml "github.com/pelletier/go-toml"
 	"gopkg.in/yaml.v2"
 )
 
 var (
-	varsFile = flag.String("d", "-", "YAML, JSON, HCL or TOML file with var values to substitute into the template. Use '-' for stdin (default).")
+	varsFiles  = &stringList{}
+	setValues  = &stringList{}
+	mergeLists = flag.Bool("merge-lists", false, "When merging multiple -d files, concatenate slice values instead of letting the later file replace them.")
+	funcSets   = flag.String("funcs", "sprig", "Comma separated function sets to attach to templates: sprig, env, none.")
+	serveAddr  = flag.String("serve", "", "Address to listen on, e.g. ':8080'. When set, the given template files are loaded once and served for render-on-demand instead of rendering once to stdout.")
+	partials   = &stringList{}
+	trimPrefix = flag.String("trim-prefix", "", "Prefix stripped from each -partials match (and the root template) when computing its template name.")
+	trimSuffix = flag.String("trim-suffix", "", "Suffix stripped from each -partials match (and the root template) when computing its template name.")
+	format     = flag.String("format", "auto", "Format of the -d data file(s): yaml, json, hcl, toml or auto (default, tries each in turn).")
+	outDir     = flag.String("o", "", "Write rendered output instead of concatenating to stdout. A directory writes each input template to <dir>/<basename-without-.tmpl>; if the data has a top-level ConfigFiles array, each {source, destination, mode, owner, group} entry is rendered and written there instead.")
+	serveAdhoc = flag.Bool("serve-allow-adhoc", false, "Allow POST /render (caller-supplied template text) in -serve mode. Off by default: that endpoint would otherwise let any network caller execute arbitrary template code in this process, and even when enabled it never gets env/expandenv/getHostByName in its FuncMap.")
 )
 
+func init() {
+	flag.Var(varsFiles, "d", "YAML, JSON, HCL or TOML file with var values to substitute into the template. Repeatable; later files are deep-merged over earlier ones. Use '-' for stdin (default if omitted).")
+	flag.Var(setValues, "set", "Override a single data value, e.g. -set foo.bar.baz=1.5. Repeatable; applied in order after all -d files are merged.")
+	flag.Var(partials, "partials", "Glob pattern (relative to the current directory) of partial templates to load alongside the root template, e.g. -partials 'layouts/*.tmpl'. Repeatable.")
+}
+
+// stringList is a repeatable flag.Value, collecting every occurrence
+// of a flag like -d a.yml -d b.yml into a slice in order given.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func Usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [options] [tmplateFile...]\n", os.Args[0])
 	flag.PrintDefaults()
@@ -55,7 +138,17 @@ func main() {
 	flag.Parse()
 	defer glog.Flush()
 
-	if len(flag.Args()) == 0 && *varsFile == "-" {
+	if *serveAddr != "" {
+		if err := serve(*serveAddr, flag.Args()); err != nil {
+			glog.Errorf("Server error: %v\n", err)
+			os.Exit(8)
+		}
+		return
+	}
+
+	files := dataFiles()
+
+	if len(flag.Args()) == 0 && readsStdin(files) {
 		fmt.Fprintf(os.Stderr, "Cannot read both template and data from stdin\n")
 		Usage()
 		os.Exit(1)
@@ -66,16 +159,24 @@ func main() {
 	var err error
 
 	// read stdin last so fail fast&first file-based info
-	if *varsFile == "-" {
+	if readsStdin(files) {
 		tmpl = readTemplates()
-		data = readData()
+		data = readData(files)
 	} else {
-		data = readData()
+		data = readData(files)
 		tmpl = readTemplates()
 	}
 
 	glog.Infof("Data is %v\n", data)
 
+	if *outDir != "" {
+		if err := writeOutput(tmpl, data, *outDir); err != nil {
+			glog.Errorf("Output write error: %v\n", err)
+			os.Exit(9)
+		}
+		return
+	}
+
 	err = tmpl.Execute(os.Stdout, data)
 	if err != nil {
 		glog.Errorf("Template execution error: %v\n", err)
@@ -83,20 +184,151 @@ func main() {
 	}
 }
 
-func readData() map[string]interface{} {
-	data, err := parseVars(*varsFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading vars data: %v\n", err)
-		os.Exit(3)
+// dataFiles returns the -d files given, or ["-"] (stdin) if none were given.
+func dataFiles() []string {
+	if len(*varsFiles) == 0 {
+		return []string{"-"}
+	}
+	return *varsFiles
+}
+
+// readsStdin reports whether any of files is "-".
+func readsStdin(files []string) bool {
+	for _, f := range files {
+		if f == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// readData parses each of files and deep-merges them in order (later
+// files override earlier keys; nested maps are merged recursively
+// rather than replaced), then applies any -set overrides on top.
+func readData(files []string) map[string]interface{} {
+	data := make(map[string]interface{})
+	for _, f := range files {
+		pv, err := parseVars(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading vars data: %v\n", err)
+			os.Exit(3)
+		}
+		deepMerge(data, pv)
+	}
+
+	for _, set := range *setValues {
+		if err := applySet(data, set); err != nil {
+			fmt.Fprintf(os.Stderr, "Error applying -set %q: %v\n", set, err)
+			os.Exit(7)
+		}
 	}
 	return data
 }
 
+// deepMerge merges src into dst in place. If both dst[k] and src[k]
+// are maps they are merged recursively; if both are slices and
+// -merge-lists was given they are concatenated; otherwise src wins.
+func deepMerge(dst, src map[string]interface{}) {
+	for k, sv := range src {
+		dv, ok := dst[k]
+		if !ok {
+			dst[k] = sv
+			continue
+		}
+		dm, dIsMap := dv.(map[string]interface{})
+		sm, sIsMap := sv.(map[string]interface{})
+		if dIsMap && sIsMap {
+			deepMerge(dm, sm)
+			continue
+		}
+		dl, dIsSlice := dv.([]interface{})
+		sl, sIsSlice := sv.([]interface{})
+		if dIsSlice && sIsSlice && *mergeLists {
+			dst[k] = append(dl, sl...)
+			continue
+		}
+		dst[k] = sv
+	}
+}
+
+// applySet parses a "-set" value of the form a.b.c=value, walks (and
+// creates as needed) the nested map[string]interface{} path a.b, and
+// sets key c to value coerced to bool, int, float64 or string (tried
+// in that order).
+func applySet(data map[string]interface{}, set string) error {
+	kv := strings.SplitN(set, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected key=value, got %q", set)
+	}
+	path := strings.Split(kv[0], ".")
+	val := coerce(kv[1])
+
+	m := data
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k]
+		if !ok {
+			nm := make(map[string]interface{})
+			m[k] = nm
+			m = nm
+			continue
+		}
+		nm, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%q is not a map", k)
+		}
+		m = nm
+	}
+	m[path[len(path)-1]] = val
+	return nil
+}
+
+// coerce tries to interpret s as a bool, int, then float64, falling
+// back to the raw string if none apply. Only the canonical
+// "true"/"false" spellings (case-insensitive) count as bool; unlike
+// strconv.ParseBool, "0" and "1" are left for the int branch below,
+// since -set replicas=1 plainly means the number, not a bool.
+func coerce(s string) interface{} {
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
 func readTemplates() *template.Template {
 
+	funcs := funcMap()
+
+	// filesystem-aware loading with partials
+	if len(*partials) > 0 {
+		if len(flag.Args()) != 1 {
+			fmt.Fprintf(os.Stderr, "-partials takes exactly one root template argument, got %d\n", len(flag.Args()))
+			os.Exit(4)
+		}
+		l := gtmpl.NewLoader(os.DirFS("."), flag.Args()[0], *partials...)
+		l.TrimPrefix = *trimPrefix
+		l.TrimSuffix = *trimSuffix
+		l.Funcs = funcs
+		t, err := l.Load()
+		if err != nil {
+			glog.Errorf("Template parsing error: %v\n", err)
+			os.Exit(4)
+		}
+		return t
+	}
+
 	// files
 	if len(flag.Args()) > 0 {
-		tmpl, err := template.ParseFiles(flag.Args()...)
+		name := filepath.Base(flag.Args()[0])
+		tmpl, err := template.New(name).Funcs(funcs).ParseFiles(flag.Args()...)
 		if err != nil {
 			glog.Errorf("Template parsing error: %v\n", err)
 			os.Exit(4)
@@ -110,7 +342,7 @@ func readTemplates() *template.Template {
 		glog.Errorf("Error reading stdin: %v\n", err)
 		os.Exit(5)
 	}
-	tmpl, err := template.New("t1").Parse(string(s))
+	tmpl, err := template.New("t1").Funcs(funcs).Parse(string(s))
 
 	if err != nil {
 		glog.Errorf("Template parsing error: %v\n", err)
@@ -119,9 +351,36 @@ func readTemplates() *template.Template {
 	return tmpl
 }
 
-// parseVars tries to parse the input and returns the result of the
-// first successful parse in this order: YAML, JSON, HCL & TOML.
-// File value of "-" will read stdin until closed and then parse.
+// funcMap builds the template.FuncMap attached to every parsed
+// template according to the comma separated sets named by -funcs.
+// "sprig" contributes the full Masterminds/sprig library (string,
+// default, date, dict/list, base64, regex, crypto, etc), "env"
+// contributes getenv/expandenv helpers and "none" attaches nothing.
+// Unknown set names are ignored with a warning so a typo doesn't
+// silently disable everything a template needs.
+func funcMap() template.FuncMap {
+	fm := template.FuncMap{}
+	for _, set := range strings.Split(*funcSets, ",") {
+		switch strings.TrimSpace(set) {
+		case "sprig":
+			for k, v := range sprig.TxtFuncMap() {
+				fm[k] = v
+			}
+		case "env":
+			fm["getenv"] = os.Getenv
+			fm["expandenv"] = os.ExpandEnv
+		case "none", "":
+			// no-op
+		default:
+			glog.Warningf("Unknown -funcs set %q ignored\n", set)
+		}
+	}
+	return fm
+}
+
+// parseVars reads file (or stdin for "-") and parses it per -format,
+// which defaults to "auto": the first successful parse, tried in
+// order YAML, JSON, HCL & TOML.
 func parseVars(file string) (map[string]interface{}, error) {
 
 	// adaptive variant of parse code in github.com/spf13/viper (MIT)
@@ -140,46 +399,148 @@ func parseVars(file string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	pv := make(map[string]interface{})
-	err = yaml.Unmarshal(v, &pv)
-	if err == nil {
+	pv, err := parseVarsBytes(v)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	return pv, nil
+}
+
+// parseVarsBytes is the byte-slice core of parseVars, shared with the
+// -serve HTTP mode where the vars data arrives as a request body
+// rather than a named file. When -format names a specific format it
+// is parsed directly, surfacing that parser's own error instead of
+// the "tried everything" composite message auto mode returns; "auto"
+// (the default) preserves the original cascading YAML/JSON/HCL/TOML
+// detection.
+func parseVarsBytes(v []byte) (map[string]interface{}, error) {
+	switch *format {
+	case "yaml":
+		return parseYAML(v)
+	case "json":
+		return parseJSON(v)
+	case "hcl":
+		return parseHCL(v)
+	case "toml":
+		return parseTOML(v)
+	case "auto", "":
+		return parseVarsAuto(v)
+	default:
+		return nil, fmt.Errorf("unknown -format %q: expected yaml, json, hcl, toml or auto", *format)
+	}
+}
+
+func parseVarsAuto(v []byte) (map[string]interface{}, error) {
+	if pv, err := parseYAML(v); err == nil {
 		glog.Info("Yaml detected")
 		return pv, nil
+	} else {
+		glog.Infof("YAML err: %v", err)
 	}
-	glog.Infof("YAML err: %v", err)
 
-	pv = make(map[string]interface{})
-	err = json.Unmarshal(v, &pv)
-	if err == nil {
+	if pv, err := parseJSON(v); err == nil {
 		// yaml should cover JSON but in case...
 		glog.Info("JSON detected")
 		return pv, nil
+	} else {
+		glog.Infof("JSON err: %v", err)
 	}
-	glog.Infof("JSON err: %v", err)
 
-	pv = make(map[string]interface{})
-	o, err1 := hcl.Parse(string(v))
-	var err2 error
-	if err1 == nil {
-		err2 = hcl.DecodeObject(&pv, o)
-	}
-	if err1 == nil && err2 == nil {
+	if pv, err := parseHCL(v); err == nil {
 		glog.Info("HCL detected")
 		return pv, nil
+	} else {
+		glog.Infof("HCL err: %v", err)
 	}
-	glog.Infof("HCL errs: %v, %v", err1, err2)
 
-	pv = make(map[string]interface{})
-	t, err := toml.LoadReader(bytes.NewBuffer(v))
-	if err == nil {
-		tm := t.ToMap()
-		for k, v := range tm {
-			pv[k] = v
-		}
+	if pv, err := parseTOML(v); err == nil {
 		glog.Info("TOML detected")
 		return pv, nil
+	} else {
+		glog.Infof("TOML err: %v", err)
 	}
-	glog.Infof("TOML err: %v", err)
 
-	return nil, fmt.Errorf("data in '%v' failed to parse as YAML, JSON, HCL or TOML", file)
+	return nil, fmt.Errorf("data failed to parse as YAML, JSON, HCL or TOML")
+}
+
+// parseYAML decodes v as one or more "---"-separated YAML documents.
+// A single document is returned as today; multiple documents are
+// exposed to templates as a top-level "Documents" slice rather than
+// silently taking just the first one.
+func parseYAML(v []byte) (map[string]interface{}, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(v))
+	var docs []interface{}
+	for {
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	if len(docs) == 1 {
+		return docs[0].(map[string]interface{}), nil
+	}
+	return map[string]interface{}{"Documents": docs}, nil
+}
+
+// parseJSON decodes v as a single JSON object, reporting the failing
+// line and column rather than just a byte offset.
+func parseJSON(v []byte) (map[string]interface{}, error) {
+	pv := make(map[string]interface{})
+	err := json.Unmarshal(v, &pv)
+	if err == nil {
+		return pv, nil
+	}
+	if se, ok := err.(*json.SyntaxError); ok {
+		line, col := lineCol(v, se.Offset)
+		return nil, fmt.Errorf("line %d, column %d: %v", line, col, se)
+	}
+	return nil, err
+}
+
+// parseHCL decodes v as HCL.
+func parseHCL(v []byte) (map[string]interface{}, error) {
+	pv := make(map[string]interface{})
+	o, err := hcl.Parse(string(v))
+	if err != nil {
+		return nil, err
+	}
+	if err := hcl.DecodeObject(&pv, o); err != nil {
+		return nil, err
+	}
+	return pv, nil
+}
+
+// parseTOML decodes v as TOML.
+func parseTOML(v []byte) (map[string]interface{}, error) {
+	t, err := toml.LoadReader(bytes.NewReader(v))
+	if err != nil {
+		return nil, err
+	}
+	pv := make(map[string]interface{})
+	for k, val := range t.ToMap() {
+		pv[k] = val
+	}
+	return pv, nil
+}
+
+// lineCol converts a byte offset into v into a 1-based line and
+// column, for turning a raw error offset into a human locatable one.
+func lineCol(v []byte, offset int64) (line, col int) {
+	line = 1
+	lineStart := int64(0)
+	for i := int64(0); i < offset && i < int64(len(v)); i++ {
+		if v[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	return line, int(offset-lineStart) + 1
 }
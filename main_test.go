@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoerce(t *testing.T) {
+	cases := []struct {
+		in   string
+		want interface{}
+	}{
+		{"true", true},
+		{"FALSE", false},
+		{"1", int64(1)},
+		{"0", int64(0)},
+		{"1.5", 1.5},
+		{"bar", "bar"},
+	}
+	for _, c := range cases {
+		if got := coerce(c.in); got != c.want {
+			t.Errorf("coerce(%q) = %v (%T), want %v (%T)", c.in, got, got, c.want, c.want)
+		}
+	}
+}
+
+func TestApplySet(t *testing.T) {
+	data := map[string]interface{}{}
+	if err := applySet(data, "a.b.c=1.5"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{
+				"c": 1.5,
+			},
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("applySet result = %#v, want %#v", data, want)
+	}
+
+	if err := applySet(data, "noequals"); err == nil {
+		t.Error("expected error for malformed -set value, got nil")
+	}
+}
+
+func TestDeepMerge(t *testing.T) {
+	dst := map[string]interface{}{
+		"a": 1,
+		"nested": map[string]interface{}{
+			"x": "one",
+			"y": "keep",
+		},
+	}
+	src := map[string]interface{}{
+		"a": 2,
+		"nested": map[string]interface{}{
+			"x": "two",
+		},
+		"b": 3,
+	}
+	deepMerge(dst, src)
+
+	want := map[string]interface{}{
+		"a": 2,
+		"nested": map[string]interface{}{
+			"x": "two",
+			"y": "keep",
+		},
+		"b": 3,
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("deepMerge result = %#v, want %#v", dst, want)
+	}
+}
+
+func TestDeepMergeLists(t *testing.T) {
+	orig := *mergeLists
+	defer func() { *mergeLists = orig }()
+
+	dst := map[string]interface{}{"list": []interface{}{"a"}}
+	src := map[string]interface{}{"list": []interface{}{"b"}}
+
+	*mergeLists = false
+	deepMerge(dst, src)
+	if want := []interface{}{"b"}; !reflect.DeepEqual(dst["list"], want) {
+		t.Errorf("without -merge-lists, list = %#v, want %#v", dst["list"], want)
+	}
+
+	dst = map[string]interface{}{"list": []interface{}{"a"}}
+	*mergeLists = true
+	deepMerge(dst, src)
+	if want := []interface{}{"a", "b"}; !reflect.DeepEqual(dst["list"], want) {
+		t.Errorf("with -merge-lists, list = %#v, want %#v", dst["list"], want)
+	}
+}
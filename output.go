@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// configFile is one entry of a top-level "ConfigFiles" array in the
+// data map, describing a template to render and where (and with what
+// permissions) to write it.
+type configFile struct {
+	Source      string
+	Destination string
+	Mode        string
+	Owner       string
+	Group       string
+}
+
+// writeOutput renders tmpl against data and writes the result under
+// outDir: in manifest mode (a top-level "ConfigFiles" array is
+// present in data) each entry's Source template is rendered with the
+// remaining data and written to its own Destination with the given
+// Mode/Owner/Group applied; otherwise every file named in
+// flag.Args() is rendered and written to
+// outDir/<basename-without-.tmpl>.
+func writeOutput(tmpl *template.Template, data map[string]interface{}, outDir string) error {
+	if cfs, ok := data["ConfigFiles"]; ok {
+		return writeManifest(tmpl, data, cfs)
+	}
+	return writeDir(tmpl, data, outDir)
+}
+
+func writeDir(tmpl *template.Template, data map[string]interface{}, outDir string) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	// In -partials mode tmpl is the single root template returned by
+	// gtmpl.Loader, registered under its own (possibly trimmed) name
+	// rather than the basename of any flag.Args() entry - ask it for
+	// its name instead of recomputing one from the raw file path.
+	if len(*partials) > 0 {
+		name := tmpl.Name()
+		dest := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(name), ".tmpl"))
+		return renderToFile(tmpl, name, data, dest)
+	}
+
+	for _, f := range flag.Args() {
+		name := filepath.Base(f)
+		dest := filepath.Join(outDir, strings.TrimSuffix(name, ".tmpl"))
+		if err := renderToFile(tmpl, name, data, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderToFile executes tmpl's named template into dest, removing
+// dest if execution fails so a partial render doesn't leave a stray
+// empty (or truncated) file behind.
+func renderToFile(tmpl *template.Template, name string, data map[string]interface{}, dest string) error {
+	w, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	err = tmpl.ExecuteTemplate(w, name, data)
+	w.Close()
+	if err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("rendering %s: %v", name, err)
+	}
+	return nil
+}
+
+func writeManifest(tmpl *template.Template, data map[string]interface{}, cfs interface{}) error {
+	entries, ok := cfs.([]interface{})
+	if !ok {
+		return fmt.Errorf("ConfigFiles must be an array")
+	}
+
+	rest := make(map[string]interface{}, len(data)-1)
+	for k, v := range data {
+		if k != "ConfigFiles" {
+			rest[k] = v
+		}
+	}
+
+	for _, e := range entries {
+		cf, err := parseConfigFile(e)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(cf.Destination), 0755); err != nil {
+			return err
+		}
+		if err := renderToFile(tmpl, cf.Source, rest, cf.Destination); err != nil {
+			return err
+		}
+
+		if err := applyFileAttrs(cf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseConfigFile(e interface{}) (configFile, error) {
+	m, ok := e.(map[string]interface{})
+	if !ok {
+		return configFile{}, fmt.Errorf("ConfigFiles entry must be a map, got %T", e)
+	}
+	cf := configFile{
+		Source:      fmt.Sprintf("%v", m["source"]),
+		Destination: fmt.Sprintf("%v", m["destination"]),
+	}
+	if v, ok := m["mode"]; ok {
+		cf.Mode = fmt.Sprintf("%v", v)
+	}
+	if v, ok := m["owner"]; ok {
+		cf.Owner = fmt.Sprintf("%v", v)
+	}
+	if v, ok := m["group"]; ok {
+		cf.Group = fmt.Sprintf("%v", v)
+	}
+	if cf.Source == "" || cf.Source == "<nil>" {
+		return configFile{}, fmt.Errorf("ConfigFiles entry missing source")
+	}
+	if cf.Destination == "" || cf.Destination == "<nil>" {
+		return configFile{}, fmt.Errorf("ConfigFiles entry missing destination")
+	}
+	return cf, nil
+}
+
+// applyFileAttrs chmods and chowns cf.Destination per cf.Mode,
+// cf.Owner and cf.Group, each skipped if empty. Chown is a genuine
+// no-op on Windows/Plan 9: os.Chown always fails there, so it's
+// skipped outright rather than letting that failure abort the whole
+// -o run on those systems.
+func applyFileAttrs(cf configFile) error {
+	if cf.Mode != "" {
+		perm, err := strconv.ParseUint(cf.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode %q for %s: %v", cf.Mode, cf.Destination, err)
+		}
+		if err := os.Chmod(cf.Destination, os.FileMode(perm)); err != nil {
+			return err
+		}
+	}
+
+	if cf.Owner == "" && cf.Group == "" {
+		return nil
+	}
+
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	if cf.Owner != "" {
+		u, err := user.Lookup(cf.Owner)
+		if err != nil {
+			return fmt.Errorf("looking up owner %q for %s: %v", cf.Owner, cf.Destination, err)
+		}
+		uid, err = strconv.Atoi(u.Uid)
+		if err != nil {
+			return err
+		}
+	}
+	if cf.Group != "" {
+		g, err := user.LookupGroup(cf.Group)
+		if err != nil {
+			return fmt.Errorf("looking up group %q for %s: %v", cf.Group, cf.Destination, err)
+		}
+		gid, err = strconv.Atoi(g.Gid)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Chown(cf.Destination, uid, gid)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	gtmpl "github.com/msample/gotmpl/pkg/tmpl"
+)
+
+// TestWriteOutputWithPartials is a regression test for -o combined
+// with -partials: the root template loaded by gtmpl.Loader is
+// registered under its own (possibly trimmed) name, not the basename
+// of the file path passed on the command line, so writeDir must ask
+// the template for its name rather than recomputing one.
+func TestWriteOutputWithPartials(t *testing.T) {
+	orig := *partials
+	*partials = stringList{"templates/layouts/*.tmpl"}
+	defer func() { *partials = orig }()
+
+	fsys := fstest.MapFS{
+		"templates/root.tmpl":           {Data: []byte(`{{ template "layouts/header" . }}body`)},
+		"templates/layouts/header.tmpl": {Data: []byte(`[{{ .Name }}]`)},
+	}
+	l := gtmpl.NewLoader(fsys, "templates/root.tmpl", *partials...)
+	l.TrimPrefix = "templates/"
+	l.TrimSuffix = ".tmpl"
+	tmpl, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	data := map[string]interface{}{"Name": "world"}
+	if err := writeOutput(tmpl, data, outDir); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(outDir, "root")
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("expected output at %s, got error: %v", dest, err)
+	}
+	if want := "[world]body"; string(b) != want {
+		t.Errorf("rendered output = %q, want %q", b, want)
+	}
+}
+
+// TestWriteManifest covers the manifest half of writeOutput: a
+// top-level ConfigFiles array renders each entry's source template
+// with the remaining data and writes it to its own destination with
+// the requested mode applied.
+func TestWriteManifest(t *testing.T) {
+	base := template.New("base")
+	if _, err := base.New("a.tmpl").Parse("A={{ .X }}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.New("b.tmpl").Parse("B={{ .X }}"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	aDest := filepath.Join(dir, "a.out")
+	bDest := filepath.Join(dir, "b.out")
+	data := map[string]interface{}{
+		"X": "1",
+		"ConfigFiles": []interface{}{
+			map[string]interface{}{"source": "a.tmpl", "destination": aDest, "mode": "0640"},
+			map[string]interface{}{"source": "b.tmpl", "destination": bDest},
+		},
+	}
+
+	if err := writeOutput(base, data, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	ab, err := os.ReadFile(aDest)
+	if err != nil {
+		t.Fatalf("reading %s: %v", aDest, err)
+	}
+	if want := "A=1"; string(ab) != want {
+		t.Errorf("%s content = %q, want %q", aDest, ab, want)
+	}
+
+	bb, err := os.ReadFile(bDest)
+	if err != nil {
+		t.Fatalf("reading %s: %v", bDest, err)
+	}
+	if want := "B=1"; string(bb) != want {
+		t.Errorf("%s content = %q, want %q", bDest, bb, want)
+	}
+
+	fi, err := os.Stat(aDest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0640 {
+		t.Errorf("%s mode = %o, want %o", aDest, got, 0640)
+	}
+}
+
+func TestParseConfigFileMissingFields(t *testing.T) {
+	if _, err := parseConfigFile(map[string]interface{}{"destination": "/tmp/x"}); err == nil {
+		t.Error("expected error for missing source, got nil")
+	}
+	if _, err := parseConfigFile(map[string]interface{}{"source": "a.tmpl"}); err == nil {
+		t.Error("expected error for missing destination, got nil")
+	}
+	if _, err := parseConfigFile("not a map"); err == nil {
+		t.Error("expected error for non-map entry, got nil")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLSingleDoc(t *testing.T) {
+	pv, err := parseYAML([]byte("foo: bar\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"foo": "bar"}
+	if !reflect.DeepEqual(pv, want) {
+		t.Errorf("parseYAML = %#v, want %#v", pv, want)
+	}
+}
+
+func TestParseYAMLMultiDoc(t *testing.T) {
+	pv, err := parseYAML([]byte("foo: one\n---\nfoo: two\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, ok := pv["Documents"].([]interface{})
+	if !ok || len(docs) != 2 {
+		t.Fatalf("parseYAML = %#v, want a 2-element Documents slice", pv)
+	}
+	if got := docs[0].(map[string]interface{})["foo"]; got != "one" {
+		t.Errorf("Documents[0].foo = %v, want one", got)
+	}
+	if got := docs[1].(map[string]interface{})["foo"]; got != "two" {
+		t.Errorf("Documents[1].foo = %v, want two", got)
+	}
+}
+
+func TestParseVarsBytesFormat(t *testing.T) {
+	orig := *format
+	defer func() { *format = orig }()
+
+	*format = "json"
+	if _, err := parseVarsBytes([]byte(`not json`)); err == nil {
+		t.Error("expected error forcing -format=json on non-JSON input, got nil")
+	}
+
+	*format = "yaml"
+	pv, err := parseVarsBytes([]byte("foo: bar\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv["foo"] != "bar" {
+		t.Errorf("parseVarsBytes with -format=yaml = %#v", pv)
+	}
+
+	*format = "bogus"
+	if _, err := parseVarsBytes([]byte("foo: bar\n")); err == nil || !strings.Contains(err.Error(), "unknown -format") {
+		t.Errorf("expected unknown -format error, got %v", err)
+	}
+}
+
+func TestParseJSONLineCol(t *testing.T) {
+	_, err := parseJSON([]byte("{\n  \"a\": ,\n}"))
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error to mention line 2, got: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Package tmpl loads multi-file Go templates - a root template plus
+// any number of partials - from an io/fs.FS, so callers can point at
+// a directory tree or an embedded FS and use {{ template "header" . }}
+// across files rather than being limited to a single flat ParseFiles
+// call.
+package tmpl
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Loader parses a root template together with any partials matched by
+// Partials glob patterns, all rooted at FS. Each parsed file is
+// registered under a name computed from its path: TrimPrefix is stripped from
+// the front of the file's path and TrimSuffix from the end, so
+// "templates/foo/bar.html.tmpl" can be registered as "foo/bar" rather
+// than the full path.
+type Loader struct {
+	FS         fs.FS
+	Root       string
+	Partials   []string
+	TrimPrefix string
+	TrimSuffix string
+	Funcs      template.FuncMap
+
+	tmpl *template.Template
+}
+
+// NewLoader returns a Loader for root, rooted at fsys, with the given
+// partial glob patterns (e.g. "layouts/*.tmpl", "includes/**/*.tmpl").
+func NewLoader(fsys fs.FS, root string, partials ...string) *Loader {
+	return &Loader{FS: fsys, Root: root, Partials: partials}
+}
+
+// Load parses Root and every file matched by Partials into a single
+// *template.Template set, named per l.name, and caches the result for
+// subsequent Render calls.
+func (l *Loader) Load() (*template.Template, error) {
+	t := template.New(l.name(l.Root)).Funcs(l.Funcs)
+
+	paths := []string{l.Root}
+	for _, pattern := range l.Partials {
+		matches, err := glob(l.FS, pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	for _, p := range paths {
+		b, err := fs.ReadFile(l.FS, p)
+		if err != nil {
+			return nil, err
+		}
+		name := l.name(p)
+		pt := t
+		if name != t.Name() {
+			pt = t.New(name)
+		}
+		if _, err := pt.Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	l.tmpl = t
+	return t, nil
+}
+
+// glob matches pattern against fsys, same as fs.Glob except it also
+// understands a "**" segment as a true recursive wildcard (fs.Glob's
+// own "**" only ever matches a single path segment, so
+// "includes/**/*.tmpl" would silently miss a file two directories
+// deep). Only one "**" per pattern is supported.
+func glob(fsys fs.FS, pattern string) ([]string, error) {
+	idx := strings.Index(pattern, "**")
+	if idx < 0 {
+		return fs.Glob(fsys, pattern)
+	}
+
+	root := strings.TrimSuffix(pattern[:idx], "/")
+	if root == "" {
+		root = "."
+	}
+	suffix := strings.TrimPrefix(pattern[idx+len("**"):], "/")
+
+	var matches []string
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		ok, err := path.Match(suffix, rel)
+		// "**" stands for zero or more directories: also try the
+		// suffix pattern against every tail of rel, so
+		// "includes/**/*.tmpl" matches files nested arbitrarily deep,
+		// not only directly in root.
+		for !ok && err == nil {
+			i := strings.Index(rel, "/")
+			if i < 0 {
+				break
+			}
+			rel = rel[i+1:]
+			ok, err = path.Match(suffix, rel)
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// name computes the template name registered for file path p by
+// trimming l.TrimPrefix from the front and l.TrimSuffix from the end.
+func (l *Loader) name(p string) string {
+	n := strings.TrimPrefix(p, l.TrimPrefix)
+	n = strings.TrimSuffix(n, l.TrimSuffix)
+	return n
+}
+
+// Render executes the template registered under name with data and
+// returns the rendered output, loading the template set on first use.
+func (l *Loader) Render(name string, data interface{}) (string, error) {
+	if l.tmpl == nil {
+		if _, err := l.Load(); err != nil {
+			return "", err
+		}
+	}
+	var buf bytes.Buffer
+	if err := l.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
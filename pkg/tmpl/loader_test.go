@@ -0,0 +1,61 @@
+package tmpl
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoaderPartials(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/root.tmpl":           {Data: []byte(`{{ template "layouts/header" . }}body`)},
+		"templates/layouts/header.tmpl": {Data: []byte(`[{{ .Name }}]`)},
+	}
+
+	l := NewLoader(fsys, "templates/root.tmpl", "templates/layouts/*.tmpl")
+	l.TrimPrefix = "templates/"
+	l.TrimSuffix = ".tmpl"
+
+	tpl, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "root"; tpl.Name() != want {
+		t.Errorf("root template name = %q, want %q", tpl.Name(), want)
+	}
+	if tpl.Lookup("layouts/header") == nil {
+		t.Fatal("partial \"layouts/header\" was not registered")
+	}
+
+	out, err := l.Render("root", map[string]interface{}{"Name": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[world]body"; out != want {
+		t.Errorf("Render = %q, want %q", out, want)
+	}
+}
+
+func TestLoaderRecursiveDoubleStar(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.tmpl":                        {Data: []byte(`root`)},
+		"includes/a.tmpl":                  {Data: []byte(`a`)},
+		"includes/sub/sub2/deep.tmpl":      {Data: []byte(`deep`)},
+		"includes/sub/sub2/notmatched.txt": {Data: []byte(`nope`)},
+	}
+
+	l := NewLoader(fsys, "root.tmpl", "includes/**/*.tmpl")
+	tpl, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"includes/a.tmpl", "includes/sub/sub2/deep.tmpl"} {
+		if tpl.Lookup(name) == nil {
+			t.Errorf("expected %q to be loaded via includes/**/*.tmpl, it wasn't", name)
+		}
+	}
+	if tpl.Lookup("includes/sub/sub2/notmatched.txt") != nil {
+		t.Error("notmatched.txt should not have matched *.tmpl")
+	}
+}
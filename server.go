@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+)
+
+// renderServer loads a fixed set of template files once at startup
+// and renders them on demand over HTTP, so callers don't have to fork
+// a gotmpl process per render.
+type renderServer struct {
+	tmpl *template.Template
+}
+
+// adhocFuncMap is funcMap() with every function that reads this
+// process's environment or resolves hostnames withheld, for use on
+// caller-supplied template text (POST /render): those are fine for
+// files reviewed at startup but not for text submitted over the
+// network.
+func adhocFuncMap() template.FuncMap {
+	fm := funcMap()
+	for _, name := range []string{"env", "expandenv", "getHostByName", "getenv"} {
+		delete(fm, name)
+	}
+	return fm
+}
+
+// serve loads files into a *template.Template and blocks serving the
+// gotmpl render API on addr until the process is killed or
+// http.ListenAndServe returns an error.
+func serve(addr string, files []string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("-serve requires at least one template file argument")
+	}
+
+	name := filepath.Base(files[0])
+	tmpl, err := template.New(name).Funcs(funcMap()).ParseFiles(files...)
+	if err != nil {
+		return fmt.Errorf("template parsing error: %v", err)
+	}
+
+	s := &renderServer{tmpl: tmpl}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/templates", s.handleTemplates)
+	mux.HandleFunc("/render/", s.handleRenderNamed)
+	mux.HandleFunc("/render", s.handleRenderMultipart)
+
+	glog.Infof("Serving %d template(s) on %s\n", len(tmpl.Templates()), addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// handleTemplates handles GET /templates, listing the names of every
+// template loaded at startup.
+func (s *renderServer) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names := make([]string, 0, len(s.tmpl.Templates()))
+	for _, t := range s.tmpl.Templates() {
+		if t.Name() != "" {
+			names = append(names, t.Name())
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// handleRenderNamed handles POST /render/{templateName}, rendering
+// the named template against a YAML/JSON/HCL/TOML body sniffed by
+// parseVarsBytes.
+func (s *renderServer) handleRenderNamed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/render/")
+	if name == "" {
+		http.Error(w, "template name required", http.StatusBadRequest)
+		return
+	}
+	t := s.tmpl.Lookup(name)
+	if t == nil {
+		http.Error(w, fmt.Sprintf("no such template %q", name), http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	data, err := parseVarsBytes(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := t.Execute(w, data); err != nil {
+		glog.Errorf("Template execution error: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleRenderMultipart handles POST /render, a multipart form
+// carrying both a "template" part (raw template text) and a "data"
+// part (YAML/JSON/HCL/TOML), for one-off renders against templates
+// not loaded at startup. Unlike /render/{name}, the template text
+// here comes straight from the caller rather than a file reviewed at
+// startup, so this endpoint is refused unless -serve-allow-adhoc was
+// given, and its FuncMap always has env/expandenv/getHostByName
+// withheld regardless, so an adhoc template can't be used to read
+// this process's environment or reach arbitrary hosts.
+func (s *renderServer) handleRenderMultipart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !*serveAdhoc {
+		http.Error(w, "POST /render is disabled; pass -serve-allow-adhoc to enable caller-supplied templates", http.StatusForbidden)
+		return
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mt, "multipart/") {
+		http.Error(w, "expected multipart/form-data body with 'template' and 'data' parts", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing multipart body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tmplText := r.FormValue("template")
+	if tmplText == "" {
+		http.Error(w, "missing 'template' part", http.StatusBadRequest)
+		return
+	}
+	t, err := template.New("multipart").Funcs(adhocFuncMap()).Parse(tmplText)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("template parsing error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	data, err := parseVarsBytes([]byte(r.FormValue("data")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := t.Execute(w, data); err != nil {
+		glog.Errorf("Template execution error: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func newTestServer(t *testing.T) *renderServer {
+	t.Helper()
+	tmpl, err := template.New("hello.tmpl").Parse(`Hello, {{ .Name }}!`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &renderServer{tmpl: tmpl}
+}
+
+func TestHandleTemplates(t *testing.T) {
+	s := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/templates", nil)
+	w := httptest.NewRecorder()
+	s.handleTemplates(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "hello.tmpl") {
+		t.Errorf("body = %q, want it to mention hello.tmpl", w.Body.String())
+	}
+}
+
+func TestHandleRenderNamed(t *testing.T) {
+	s := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/render/hello.tmpl", strings.NewReader(`{"Name":"World"}`))
+	w := httptest.NewRecorder()
+	s.handleRenderNamed(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if want := "Hello, World!"; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+}
+
+func TestHandleRenderNamedUnknownTemplate(t *testing.T) {
+	s := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/render/nope.tmpl", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	s.handleRenderNamed(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestHandleRenderMultipart(t *testing.T) {
+	orig := *serveAdhoc
+	*serveAdhoc = true
+	defer func() { *serveAdhoc = orig }()
+
+	s := newTestServer(t)
+
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("template", `Hi, {{ .Name }}!`)
+	mw.WriteField("data", `{"Name":"Multi"}`)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.handleRenderMultipart(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if want := "Hi, Multi!"; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+}
+
+func TestHandleRenderMultipartDisabledByDefault(t *testing.T) {
+	orig := *serveAdhoc
+	*serveAdhoc = false
+	defer func() { *serveAdhoc = orig }()
+
+	s := newTestServer(t)
+
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("template", `Hi, {{ .Name }}!`)
+	mw.WriteField("data", `{"Name":"Multi"}`)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.handleRenderMultipart(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+}
+
+func TestHandleRenderMultipartWithholdsEnvFuncs(t *testing.T) {
+	orig := *serveAdhoc
+	*serveAdhoc = true
+	defer func() { *serveAdhoc = orig }()
+
+	origSets := *funcSets
+	*funcSets = "sprig,env"
+	defer func() { *funcSets = origSets }()
+
+	s := newTestServer(t)
+
+	t.Setenv("GOTMPL_TEST_SECRET", "leaked")
+	for _, tmplText := range []string{
+		`{{ env "GOTMPL_TEST_SECRET" }}`,
+		`{{ expandenv "$GOTMPL_TEST_SECRET" }}`,
+		`{{ getHostByName "localhost" }}`,
+		`{{ getenv "GOTMPL_TEST_SECRET" }}`,
+	} {
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("template", tmplText)
+		mw.WriteField("data", `{}`)
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		s.handleRenderMultipart(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("template %q: status = %d, body = %s; want 400 (function not defined)", tmplText, w.Code, w.Body.String())
+		}
+	}
+}